@@ -0,0 +1,252 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"debug/elf"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+var noAutoLibs = flag.Bool("no-auto-libs", false, "Disable automatic discovery of a binary's shared library dependencies from its ELF metadata; fall back to the hardcoded x86-64/GRTE library list")
+
+// fallbackLibs are bind-mounted when automatic discovery is disabled, fails,
+// or finds no dynamic linker (a statically linked binary), matching the
+// historical hardcoded library set.
+var fallbackLibs = []string{
+	"/lib64/ld-linux-x86-64.so.2",           // dynamic linker.
+	"/lib/x86_64-linux-gnu/libc.so.6",       // libc.
+	"/lib/x86_64-linux-gnu/libpthread.so.0", // libpthread.
+
+	"/usr/grte/v4/lib64/ld-linux-x86-64.so.2", // dynamic linker.
+	"/usr/grte/v4/lib64/libc.so.6",            // libc.
+	"/usr/grte/v4/lib64/libpthread.so.0",      // libpthread.
+}
+
+// interp returns binary's ELF PT_INTERP path (i.e. its dynamic linker), or
+// "" if binary is statically linked and has no interpreter.
+func interp(binary string) (string, error) {
+	f, err := elf.Open(binary)
+	if err != nil {
+		return "", fmt.Errorf("error opening %q as ELF: %v", binary, err)
+	}
+	defer f.Close()
+
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_INTERP {
+			continue
+		}
+		data := make([]byte, prog.Filesz)
+		if _, err := prog.ReadAt(data, 0); err != nil {
+			return "", fmt.Errorf("error reading PT_INTERP of %q: %v", binary, err)
+		}
+		return strings.TrimRight(string(data), "\x00"), nil
+	}
+	return "", nil
+}
+
+// defaultLibrarySearchPaths are searched for a library dependency after
+// LD_LIBRARY_PATH and /etc/ld.so.conf, mirroring the dynamic linker's own
+// fallback search path.
+var defaultLibrarySearchPaths = []string{
+	"/lib",
+	"/lib64",
+	"/usr/lib",
+	"/usr/lib64",
+	"/lib/x86_64-linux-gnu",
+	"/usr/lib/x86_64-linux-gnu",
+	"/usr/grte/v4/lib64",
+}
+
+// ldLibraryPathDirs returns the directories listed in LD_LIBRARY_PATH.
+func ldLibraryPathDirs() []string {
+	v := os.Getenv("LD_LIBRARY_PATH")
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ":")
+}
+
+// ldSoConfPaths parses an ld.so.conf-style file at path, following any
+// "include" directives (interpreted as glob patterns relative to path's
+// directory, as ldconfig does), and returns the library search directories
+// it lists. Missing files are silently ignored, matching ldconfig's own
+// tolerance of an absent /etc/ld.so.conf.
+func ldSoConfPaths(path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var dirs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if rest := strings.TrimPrefix(line, "include "); rest != line {
+			pattern := strings.TrimSpace(rest)
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(filepath.Dir(path), pattern)
+			}
+			matches, _ := filepath.Glob(pattern)
+			for _, m := range matches {
+				dirs = append(dirs, ldSoConfPaths(m)...)
+			}
+			continue
+		}
+		dirs = append(dirs, line)
+	}
+	return dirs
+}
+
+// resolveLibrary searches searchPaths, in order, for a file named name and
+// returns the first match.
+func resolveLibrary(name string, searchPaths []string) (string, bool) {
+	for _, dir := range searchPaths {
+		candidate := filepath.Join(dir, name)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// discoverLibs returns the full transitive closure of shared libraries that
+// binary depends on, including its dynamic linker, resolved to their actual
+// host paths. Dependencies are found by reading each library's ELF
+// DT_NEEDED entries and resolving them via LD_LIBRARY_PATH,
+// /etc/ld.so.conf, and defaultLibrarySearchPaths, the same sources the
+// dynamic linker itself consults at runtime. Critically, this never
+// executes binary (or any of its dependencies) on the host: running an
+// untrusted binary's own dynamic linker against it (e.g. via `ld.so
+// --list`) would execute its ELF constructors, which is exactly the
+// unsandboxed execution gvrun exists to avoid. A nil, nil return means
+// binary is statically linked and has no dependencies to discover.
+func discoverLibs(binary string) ([]string, error) {
+	ld, err := interp(binary)
+	if err != nil {
+		return nil, err
+	}
+	if ld == "" {
+		return nil, nil
+	}
+
+	genericSearchPaths := ldLibraryPathDirs()
+	genericSearchPaths = append(genericSearchPaths, ldSoConfPaths("/etc/ld.so.conf")...)
+	genericSearchPaths = append(genericSearchPaths, defaultLibrarySearchPaths...)
+
+	// Directories belonging to the binary's own loader, and to
+	// dependencies resolved from it, are searched before the generic
+	// system paths above. This matters for e.g. GRTE-linked binaries,
+	// whose PT_INTERP lives under /usr/grte/v4/lib64: a DT_NEEDED of
+	// "libc.so.6" must resolve to the GRTE libc alongside it, not the
+	// ABI-incompatible system glibc that the generic paths would
+	// otherwise find first.
+	priorityDirs := []string{filepath.Dir(ld)}
+
+	libs := []string{ld}
+	seen := map[string]bool{}
+
+	queue := []string{binary}
+	for len(queue) > 0 {
+		path := queue[0]
+		queue = queue[1:]
+
+		f, err := elf.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("error opening %q as ELF: %v", path, err)
+		}
+		needed, err := f.ImportedLibraries()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading DT_NEEDED of %q: %v", path, err)
+		}
+
+		for _, dep := range needed {
+			if seen[dep] {
+				continue
+			}
+			seen[dep] = true
+
+			searchPaths := append(append([]string{}, priorityDirs...), genericSearchPaths...)
+			resolved, ok := resolveLibrary(dep, searchPaths)
+			if !ok {
+				log.Printf("Warning: could not resolve library dependency %q of %q; it will not be available in the sandbox", dep, path)
+				continue
+			}
+			libs = append(libs, resolved)
+			queue = append(queue, resolved)
+
+			if dir := filepath.Dir(resolved); !containsDir(priorityDirs, dir) {
+				priorityDirs = append(priorityDirs, dir)
+			}
+		}
+	}
+	return libs, nil
+}
+
+// containsDir reports whether dirs contains dir.
+func containsDir(dirs []string, dir string) bool {
+	for _, d := range dirs {
+		if d == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// libraryMounts returns the bind mounts needed to grant binary access to its
+// dynamic linker and shared library dependencies. Unless -no-auto-libs is
+// set, it discovers these automatically by statically parsing binary's ELF
+// metadata; if discovery is disabled, fails, or reports binary as statically
+// linked, it falls back to the historical hardcoded x86-64/GRTE library list.
+func libraryMounts(binary string) ([]specs.Mount, error) {
+	if !*noAutoLibs {
+		libs, err := discoverLibs(binary)
+		if err != nil {
+			log.Printf("Warning: automatic library discovery failed, falling back to hardcoded library list: %v", err)
+		} else if libs != nil {
+			mounts := make([]specs.Mount, 0, len(libs))
+			for _, lib := range libs {
+				m, err := resolvedMount(lib, mountOpts{})
+				if err != nil {
+					return nil, err
+				}
+				mounts = append(mounts, m)
+			}
+			return mounts, nil
+		}
+	}
+
+	mounts := make([]specs.Mount, 0, len(fallbackLibs))
+	for _, lib := range fallbackLibs {
+		m, err := resolvedMount(lib, mountOpts{})
+		if err != nil {
+			return nil, err
+		}
+		mounts = append(mounts, m)
+	}
+	return mounts, nil
+}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math/rand"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -35,8 +36,38 @@ var (
 
 	extraEnv  = flag.String("extra_env", "", "Comma-separated list of environment variables to set")
 	extraDirs = flag.String("extra_dirs", "", "Comma-separated list of extra directories (or files) to provide read-only access to")
+
+	rootless = flag.Bool("rootless", false, "Run without requiring sudo, using a user namespace to map the invoking user to root inside the sandbox. This provides weaker defense-in-depth than the default sudo-based setup; see the runsc -rootless flag for details")
+
+	printMounts = flag.Bool("print-mounts", false, "Print the mounts that would be granted to the sandbox and exit without running runsc")
+
+	network  = flag.String("network", "none", "Network mode to give the sandbox: none, host, or sandbox")
+	strace   = flag.Bool("strace", false, "Enable runsc strace logging")
+	debug    = flag.Bool("debug", false, "Enable runsc debug logging")
+	debugLog = flag.String("debug-log", "", "Directory to write runsc debug and gofer logs to; created if it does not exist")
+	name     = flag.String("name", "", "Container name (default: a uniquified gvrun-<pid>-<rand> name, so concurrent invocations don't collide in runsc's container registry)")
 )
 
+// rootlessIDMappings returns the uidMappings/gidMappings entries needed to
+// map the invoking user to root inside the sandbox's user namespace.
+func rootlessIDMappings(uid, gid uint32) ([]specs.LinuxIDMapping, []specs.LinuxIDMapping) {
+	uidMappings := []specs.LinuxIDMapping{
+		{
+			ContainerID: 0,
+			HostID:      uid,
+			Size:        1,
+		},
+	}
+	gidMappings := []specs.LinuxIDMapping{
+		{
+			ContainerID: 0,
+			HostID:      gid,
+			Size:        1,
+		},
+	}
+	return uidMappings, gidMappings
+}
+
 // originalUser return the uid, gid, and username of the user that invoked this
 // binary. Note that this must be invoked under sudo, so this is the user
 // invoking sudo, not root.
@@ -113,12 +144,55 @@ func run() error {
 
 	// TODO(prattmic): ask for user confirmation for above access?
 
-	// We pretend to be the current host user. This simplifies file access
-	// (files are often accessible only by this user), but we should
-	// consider locking this down more.
-	uid, gid, username, err := originalUser()
+	var (
+		username string
+		user     specs.User
+		linux    *specs.Linux
+	)
+	if *rootless {
+		// There is no sudo to tell us who invoked us; run as the
+		// current euid/egid and map it to root inside a user
+		// namespace so the sandboxed process still appears to own
+		// its files.
+		uid, gid := uint32(os.Geteuid()), uint32(os.Getegid())
+		username = os.Getenv("USER")
+		user = specs.User{UID: 0, GID: 0, Username: username}
+
+		uidMappings, gidMappings := rootlessIDMappings(uid, gid)
+		linux = &specs.Linux{
+			Namespaces: []specs.LinuxNamespace{
+				{Type: specs.UserNamespace},
+			},
+			UIDMappings: uidMappings,
+			GIDMappings: gidMappings,
+		}
+	} else {
+		// We pretend to be the current host user. This simplifies file
+		// access (files are often accessible only by this user), but we
+		// should consider locking this down more.
+		uid, gid, un, err := originalUser()
+		if err != nil {
+			return fmt.Errorf("error determining user: %v", err)
+		}
+		username = un
+		user = specs.User{UID: uid, GID: gid, Username: username}
+	}
+
+	// The binary and working directory are granted read-write access,
+	// matching their host permissions, so that e.g. build artifacts,
+	// test output, and logs written to cwd still work. Use
+	// -mount=...:ro to restrict this.
+	binaryMount, err := resolvedMount(binary, mountOpts{rw: true})
+	if err != nil {
+		return fmt.Errorf("error granting access to %q: %v", binary, err)
+	}
+	wdMount, err := resolvedMount(wd, mountOpts{rw: true})
 	if err != nil {
-		return fmt.Errorf("error determining user: %v", err)
+		return fmt.Errorf("error granting access to %q: %v", wd, err)
+	}
+	libMounts, err := libraryMounts(binary)
+	if err != nil {
+		return fmt.Errorf("error resolving library dependencies of %q: %v", binary, err)
 	}
 
 	spec := &specs.Spec{
@@ -129,32 +203,18 @@ func run() error {
 				"PATH=/usr/local/bin:/usr/bin:/bin",
 				"USER=" + username,
 			},
-			Cwd: wd,
-			User: specs.User{
-				UID:      uid,
-				GID:      gid,
-				Username: username,
-			},
+			Cwd:          wd,
+			User:         user,
 			Capabilities: nil, // none!
 		},
 		Hostname: "runsc-gvrun",
 		Root: &specs.Root{
 			Path: rootPath,
 		},
-		Mounts: []specs.Mount{
-			// Grant access to the binary and working directory.
-			resolvedMount(binary),
-			resolvedMount(wd),
-
-			// Important libraries.
-			resolvedMount("/lib64/ld-linux-x86-64.so.2"),           // dynamic linker.
-			resolvedMount("/lib/x86_64-linux-gnu/libc.so.6"),       // libc.
-			resolvedMount("/lib/x86_64-linux-gnu/libpthread.so.0"), // libpthread.
-
-			resolvedMount("/usr/grte/v4/lib64/ld-linux-x86-64.so.2"), // dynamic linker.
-			resolvedMount("/usr/grte/v4/lib64/libc.so.6"),            // libc.
-			resolvedMount("/usr/grte/v4/lib64/libpthread.so.0"),      // libpthread.
-		},
+		Linux: linux,
+		// Grant access to the binary, working directory, and the
+		// binary's library dependencies.
+		Mounts: append([]specs.Mount{binaryMount, wdMount}, libMounts...),
 	}
 
 	if *extraEnv != "" {
@@ -168,8 +228,45 @@ func run() error {
 		dirs := strings.Split(*extraDirs, ",")
 		for _, d := range dirs {
 			log.Printf("Granting read access to %q", d)
-			spec.Mounts = append(spec.Mounts, resolvedMount(d))
+			m, err := resolvedMount(d, mountOpts{})
+			if err != nil {
+				return fmt.Errorf("error granting access to %q: %v", d, err)
+			}
+			spec.Mounts = append(spec.Mounts, m)
+		}
+	}
+
+	spec.Mounts = append(spec.Mounts, extraMounts...)
+	spec.Mounts = append(spec.Mounts, tmpfsMounts...)
+
+	resources, rlimits, err := resourceLimits()
+	if err != nil {
+		return fmt.Errorf("error computing resource limits: %v", err)
+	}
+	spec.Process.Rlimits = rlimits
+	if resources != nil {
+		if spec.Linux == nil {
+			spec.Linux = &specs.Linux{}
 		}
+		spec.Linux.Resources = resources
+	}
+
+	seccomp, err := seccompSpec()
+	if err != nil {
+		return fmt.Errorf("error computing seccomp profile: %v", err)
+	}
+	if seccomp != nil {
+		if spec.Linux == nil {
+			spec.Linux = &specs.Linux{}
+		}
+		spec.Linux.Seccomp = seccomp
+	}
+
+	if *printMounts {
+		for _, m := range spec.Mounts {
+			fmt.Printf("%s -> %s\n", m.Source, m.Destination)
+		}
+		return nil
 	}
 
 	if err := json.NewEncoder(specFile).Encode(spec); err != nil {
@@ -192,24 +289,46 @@ func run() error {
 		return fmt.Errorf("error setting rlimit: %v", err)
 	}
 
+	switch *network {
+	case "none", "host", "sandbox":
+	default:
+		return fmt.Errorf("invalid -network %q: must be none, host, or sandbox", *network)
+	}
+
 	cmd := exec.Command(*runscBin)
 	// Write to in-memory overlayfs, not host.
 	cmd.Args = append(cmd.Args, "--overlay")
-	// No networking.
-	cmd.Args = append(cmd.Args, "--network=none")
+	cmd.Args = append(cmd.Args, "--network="+*network)
+
+	if *rootless {
+		cmd.Args = append(cmd.Args, "--rootless=true")
+	}
 
 	// Debugging.
-	// cmd.Args = append(cmd.Args, "--strace")
-	// cmd.Args = append(cmd.Args, "--debug")
-	// cmd.Args = append(cmd.Args, "--debug-log=/tmp/")
+	if *strace {
+		cmd.Args = append(cmd.Args, "--strace")
+	}
+	if *debug {
+		cmd.Args = append(cmd.Args, "--debug")
+	}
+	if *debugLog != "" {
+		if err := os.MkdirAll(*debugLog, 0755); err != nil {
+			return fmt.Errorf("error creating debug log directory %q: %v", *debugLog, err)
+		}
+		// A trailing slash makes runsc treat debugLog as a directory
+		// and write both boot and gofer logs under it.
+		cmd.Args = append(cmd.Args, "--debug-log="+strings.TrimSuffix(*debugLog, "/")+"/")
+	}
 
 	cmd.Args = append(cmd.Args, "run")
 	// Spec location.
 	cmd.Args = append(cmd.Args, "--bundle", dir)
-	// Container name.
-	//
-	// TODO(prattmic): make unique?
-	cmd.Args = append(cmd.Args, "gvrun")
+
+	containerName := *name
+	if containerName == "" {
+		containerName = fmt.Sprintf("gvrun-%d-%d", os.Getpid(), rand.Int31())
+	}
+	cmd.Args = append(cmd.Args, containerName)
 
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
@@ -221,24 +340,6 @@ func run() error {
 	return nil
 }
 
-// resolvedMount returns a bind mount for path that points to the actual
-// location of path (resolving any symlinks). This avoids the need to also
-// mount all the symlinks along the way.
-func resolvedMount(path string) specs.Mount {
-	// Resolve final location of path.
-	resolved, err := filepath.EvalSymlinks(path)
-	if err != nil {
-		// TODO(prattmic): return error.
-		panic(fmt.Sprintf("failed to resolve symlinks of %q: %v", path, err))
-	}
-
-	return specs.Mount{
-		Type:        "bind",
-		Destination: path,
-		Source:      resolved,
-	}
-}
-
 func main() {
 	flag.Parse()
 
@@ -0,0 +1,181 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+var (
+	extraMounts mountFlags
+	tmpfsMounts tmpfsFlags
+)
+
+func init() {
+	flag.Var(&extraMounts, "mount", "Bind mount to grant the sandbox, in the form src[:dst][:ro|rw][,propagation=private|slave|rslave][,noexec]; dst defaults to src; may be repeated")
+	flag.Var(&tmpfsMounts, "tmpfs", "Writable tmpfs mount to grant the sandbox, in the form /path[:size=<bytes>]; may be repeated")
+}
+
+// mountOpts describes how resolvedMount should build a bind mount.
+type mountOpts struct {
+	dst         string
+	rw          bool
+	propagation string // "", "private", "slave", or "rslave".
+	noexec      bool
+}
+
+// resolvedMount returns a bind mount for src that points to its actual
+// location (resolving any symlinks), configured according to opts. This
+// avoids the need to also mount all the symlinks along the way.
+func resolvedMount(src string, opts mountOpts) (specs.Mount, error) {
+	resolved, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return specs.Mount{}, fmt.Errorf("failed to resolve symlinks of %q: %v", src, err)
+	}
+
+	dst := opts.dst
+	if dst == "" {
+		dst = src
+	}
+
+	var options []string
+	if opts.rw {
+		options = append(options, "rw")
+	} else {
+		options = append(options, "ro")
+	}
+	switch opts.propagation {
+	case "", "private":
+		// OCI default; nothing to add.
+	case "slave", "rslave":
+		options = append(options, opts.propagation)
+	}
+	if opts.noexec {
+		options = append(options, "noexec")
+	}
+
+	return specs.Mount{
+		Type:        "bind",
+		Destination: dst,
+		Source:      resolved,
+		Options:     options,
+	}, nil
+}
+
+// mountFlags accumulates repeated -mount=src[:dst][:ro|rw][,propagation=...][,noexec] flags.
+type mountFlags []specs.Mount
+
+func (m *mountFlags) String() string {
+	return fmt.Sprint([]specs.Mount(*m))
+}
+
+func (m *mountFlags) Set(value string) error {
+	src, opts, err := parseMountFlag(value)
+	if err != nil {
+		return err
+	}
+	mount, err := resolvedMount(src, opts)
+	if err != nil {
+		return fmt.Errorf("invalid -mount %q: %v", value, err)
+	}
+	*m = append(*m, mount)
+	return nil
+}
+
+// parseMountFlag parses the src[:dst][:ro|rw][,propagation=...][,noexec]
+// syntax accepted by -mount.
+func parseMountFlag(value string) (string, mountOpts, error) {
+	fields := strings.Split(value, ",")
+
+	var opts mountOpts
+	for _, f := range fields[1:] {
+		switch {
+		case f == "noexec":
+			opts.noexec = true
+		case strings.HasPrefix(f, "propagation="):
+			prop := strings.TrimPrefix(f, "propagation=")
+			switch prop {
+			case "shared", "rshared":
+				// Shared propagation would let the sandboxed
+				// process's mount changes propagate back out
+				// to the host, breaking sandbox isolation.
+				return "", mountOpts{}, fmt.Errorf("invalid -mount %q: propagation=%s would break sandbox isolation from the host", value, prop)
+			case "private", "slave", "rslave":
+				opts.propagation = prop
+			default:
+				return "", mountOpts{}, fmt.Errorf("invalid -mount %q: unknown propagation %q", value, prop)
+			}
+		default:
+			return "", mountOpts{}, fmt.Errorf("invalid -mount %q: unknown option %q", value, f)
+		}
+	}
+
+	srcDst := strings.Split(fields[0], ":")
+	src := srcDst[0]
+	if src == "" {
+		return "", mountOpts{}, fmt.Errorf("invalid -mount %q: missing source path", value)
+	}
+	for _, f := range srcDst[1:] {
+		switch f {
+		case "ro":
+			opts.rw = false
+		case "rw":
+			opts.rw = true
+		default:
+			if opts.dst != "" {
+				return "", mountOpts{}, fmt.Errorf("invalid -mount %q: unexpected %q", value, f)
+			}
+			opts.dst = f
+		}
+	}
+
+	return src, opts, nil
+}
+
+// tmpfsFlags accumulates repeated -tmpfs=/path[:size=<bytes>] flags.
+type tmpfsFlags []specs.Mount
+
+func (t *tmpfsFlags) String() string {
+	return fmt.Sprint([]specs.Mount(*t))
+}
+
+func (t *tmpfsFlags) Set(value string) error {
+	fields := strings.Split(value, ":")
+	dst := fields[0]
+	if dst == "" {
+		return fmt.Errorf("invalid -tmpfs %q: missing destination path", value)
+	}
+
+	options := []string{"rw", "noatime"}
+	for _, f := range fields[1:] {
+		if !strings.HasPrefix(f, "size=") {
+			return fmt.Errorf("invalid -tmpfs %q: unexpected option %q", value, f)
+		}
+		options = append(options, f)
+	}
+
+	*t = append(*t, specs.Mount{
+		Type:        "tmpfs",
+		Destination: dst,
+		Source:      "tmpfs",
+		Options:     options,
+	})
+	return nil
+}
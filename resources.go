@@ -0,0 +1,155 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+var (
+	memoryLimit = flag.Uint64("memory", 0, "Memory limit in bytes for the sandboxed process (0 = unlimited)")
+	cpuLimit    = flag.Float64("cpus", 0, "CPU limit, in fractional CPUs (0 = unlimited)")
+	pidsMax     = flag.Int64("pids-max", 0, "Maximum number of processes/threads permitted in the sandbox (0 = unlimited)")
+
+	userRlimits rlimitFlags
+)
+
+func init() {
+	flag.Var(&userRlimits, "rlimit", "Resource limit to set inside the sandbox, in the form NAME=soft:hard (e.g. -rlimit=NOFILE=65536:65536); may be repeated")
+}
+
+// rlimitFlags accumulates repeated -rlimit=NAME=soft:hard flags.
+type rlimitFlags []specs.POSIXRlimit
+
+func (r *rlimitFlags) String() string {
+	return fmt.Sprint([]specs.POSIXRlimit(*r))
+}
+
+func (r *rlimitFlags) Set(value string) error {
+	nameVal := strings.SplitN(value, "=", 2)
+	if len(nameVal) != 2 {
+		return fmt.Errorf("invalid -rlimit %q: want NAME=soft:hard", value)
+	}
+	softHard := strings.SplitN(nameVal[1], ":", 2)
+	if len(softHard) != 2 {
+		return fmt.Errorf("invalid -rlimit %q: want NAME=soft:hard", value)
+	}
+	soft, err := strconv.ParseUint(softHard[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid -rlimit %q: invalid soft limit: %v", value, err)
+	}
+	hard, err := strconv.ParseUint(softHard[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid -rlimit %q: invalid hard limit: %v", value, err)
+	}
+	*r = append(*r, specs.POSIXRlimit{
+		Type: "RLIMIT_" + strings.ToUpper(nameVal[0]),
+		Soft: soft,
+		Hard: hard,
+	})
+	return nil
+}
+
+// defaultRlimits returns the podman-style default NOFILE/NPROC maxima,
+// skipping any limit the user already supplied via -rlimit.
+func defaultRlimits() []specs.POSIXRlimit {
+	const (
+		defaultNOFILE = 1048576
+		defaultNPROC  = 1048576
+	)
+
+	have := map[string]bool{}
+	for _, r := range userRlimits {
+		have[r.Type] = true
+	}
+
+	var defaults []specs.POSIXRlimit
+	if !have["RLIMIT_NOFILE"] {
+		defaults = append(defaults, specs.POSIXRlimit{Type: "RLIMIT_NOFILE", Soft: defaultNOFILE, Hard: defaultNOFILE})
+	}
+	if !have["RLIMIT_NPROC"] {
+		defaults = append(defaults, specs.POSIXRlimit{Type: "RLIMIT_NPROC", Soft: defaultNPROC, Hard: defaultNPROC})
+	}
+	return defaults
+}
+
+// hostMemTotal returns the host's MemTotal, in bytes, from /proc/meminfo.
+func hostMemTotal() (uint64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, fmt.Errorf("error opening /proc/meminfo: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("error parsing MemTotal %q: %v", fields[1], err)
+			}
+			return kb * 1024, nil
+		}
+	}
+	return 0, fmt.Errorf("MemTotal not found in /proc/meminfo")
+}
+
+// resourceLimits builds the Linux.Resources block and Process.Rlimits
+// implied by -memory, -cpus, -pids-max, and -rlimit. resources is nil if
+// none of -memory, -cpus, or -pids-max were set.
+func resourceLimits() (resources *specs.LinuxResources, rlimits []specs.POSIXRlimit, err error) {
+	var r specs.LinuxResources
+	var set bool
+
+	if *memoryLimit > 0 {
+		total, err := hostMemTotal()
+		if err != nil {
+			return nil, nil, err
+		}
+		if *memoryLimit > total {
+			return nil, nil, fmt.Errorf("-memory %d exceeds host MemTotal %d", *memoryLimit, total)
+		}
+		limit := int64(*memoryLimit)
+		r.Memory = &specs.LinuxMemory{Limit: &limit}
+		set = true
+	}
+
+	if *cpuLimit > 0 {
+		period := uint64(100000) // 100ms, matches runc/podman's default CFS period.
+		quota := int64(*cpuLimit * float64(period))
+		r.CPU = &specs.LinuxCPU{Quota: &quota, Period: &period}
+		set = true
+	}
+
+	if *pidsMax > 0 {
+		r.Pids = &specs.LinuxPids{Limit: *pidsMax}
+		set = true
+	}
+
+	rlimits = append(defaultRlimits(), userRlimits...)
+
+	if !set {
+		return nil, rlimits, nil
+	}
+	return &r, rlimits, nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+var seccompProfile = flag.String("seccomp", "", `Path to a Docker/OCI-style seccomp JSON profile to apply to the sandboxed process, in addition to gVisor's own syscall interception. "none" disables seccomp filtering entirely. Defaults to a bundled allowlist profile modeled on the moby/podman defaults`)
+
+//go:embed default.json
+var defaultSeccompProfile []byte
+
+// seccompSpec returns the Linux.Seccomp block to apply, derived from
+// -seccomp. A nil return means no seccomp filter should be configured.
+func seccompSpec() (*specs.LinuxSeccomp, error) {
+	if *seccompProfile == "none" {
+		return nil, nil
+	}
+
+	data := defaultSeccompProfile
+	if *seccompProfile != "" {
+		d, err := ioutil.ReadFile(*seccompProfile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading seccomp profile %q: %v", *seccompProfile, err)
+		}
+		data = d
+	}
+
+	var seccomp specs.LinuxSeccomp
+	if err := json.Unmarshal(data, &seccomp); err != nil {
+		return nil, fmt.Errorf("error parsing seccomp profile: %v", err)
+	}
+	return &seccomp, nil
+}